@@ -0,0 +1,51 @@
+// Package chi adapts simplerelic metrics to the go-chi/chi router,
+// reporting route templates the same way the Gin Handler reports c.FullPath().
+package chi
+
+import (
+	"net/http"
+	"time"
+
+	gochi "github.com/go-chi/chi/v5"
+
+	"github.com/domenp/simplerelic"
+)
+
+// statusRecorder wraps http.ResponseWriter to capture the status code
+// written, since net/http doesn't expose it directly.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware wraps an http.Handler, updating simplerelic.SimpleReporter's
+// metrics after each request. It must be mounted inside chi's routing tree
+// (e.g. r.Use(chi.Middleware)) so the route context carries the matched
+// pattern by the time the handler returns.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		var routeTemplate string
+		if rc := gochi.RouteContext(r.Context()); rc != nil {
+			routeTemplate = rc.RoutePattern()
+		}
+
+		simplerelic.SimpleReporter.Update(simplerelic.RequestInfo{
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			RouteTemplate: routeTemplate,
+			Status:        rec.status,
+			Duration:      time.Since(start),
+		})
+	})
+}
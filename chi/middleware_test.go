@@ -0,0 +1,69 @@
+package chi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gochi "github.com/go-chi/chi/v5"
+
+	"github.com/domenp/simplerelic"
+)
+
+func TestMiddlewareCapturesRouteTemplate(t *testing.T) {
+
+	metric := simplerelic.NewReqPerRoute()
+	reporter, err := simplerelic.NewReporter("chitest", "fake-licence", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating reporter: %s", err)
+	}
+	reporter.AddMetric(metric)
+	simplerelic.SimpleReporter = reporter
+
+	r := gochi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("expected the wrapped handler's status to pass through, got %d", rec.Code)
+	}
+
+	values := metric.ValueMap()
+	if values["Component/ReqPerEndpoint//users/{id}[requests]"] != 1 {
+		t.Errorf("expected route template /users/{id} to be tracked, got %v", values)
+	}
+}
+
+func TestMiddlewareWithoutMatchedRoute(t *testing.T) {
+
+	metric := simplerelic.NewReqPerRoute()
+	reporter, err := simplerelic.NewReporter("chitest2", "fake-licence", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating reporter: %s", err)
+	}
+	reporter.AddMetric(metric)
+	simplerelic.SimpleReporter = reporter
+
+	r := gochi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("GET", "/does-not-exist", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected chi's default 404, got %d", rec.Code)
+	}
+
+	values := metric.ValueMap()
+	if values["Component/ReqPerEndpoint/other[requests]"] != 1 {
+		t.Errorf("expected an unmatched route to collapse into \"other\", got %v", values)
+	}
+}
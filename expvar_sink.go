@@ -0,0 +1,49 @@
+package simplerelic
+
+import (
+	"expvar"
+	"sync"
+)
+
+// ExpvarSink publishes metrics under an expvar.Map named after the
+// component, so they show up alongside the rest of the process's
+// published variables at /debug/vars.
+type ExpvarSink struct {
+	lock sync.Mutex
+	maps map[string]*expvar.Map
+}
+
+// NewExpvarSink creates a new ExpvarSink
+func NewExpvarSink() *ExpvarSink {
+	return &ExpvarSink{maps: make(map[string]*expvar.Map)}
+}
+
+// Publish sets the metrics on the expvar.Map for the given component
+func (sink *ExpvarSink) Publish(component string, metrics map[string]float32) error {
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	m, ok := sink.maps[component]
+	if !ok {
+		// expvar's registry is process-global, so a second ExpvarSink
+		// (or a restarted Reporter) publishing under the same component
+		// name must reuse the already-registered Map rather than call
+		// expvar.NewMap again, which panics on a duplicate name.
+		if existing := expvar.Get(component); existing != nil {
+			m, ok = existing.(*expvar.Map)
+		}
+		if !ok {
+			m = expvar.NewMap(component)
+		}
+		sink.maps[component] = m
+	}
+
+	for name, value := range metrics {
+		v := new(expvar.Float)
+		v.Set(float64(value))
+		m.Set(name, v)
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package simplerelic
+
+import "testing"
+
+func TestExpvarSinkPublishReusesMap(t *testing.T) {
+
+	sink := NewExpvarSink()
+
+	if err := sink.Publish("expvarsinktest", map[string]float32{"requests": 1}); err != nil {
+		t.Fatalf("unexpected error on first publish: %s", err)
+	}
+
+	// A second Publish for the same component must reuse the map instead
+	// of calling expvar.NewMap again, which panics on a duplicate name.
+	if err := sink.Publish("expvarsinktest", map[string]float32{"requests": 2}); err != nil {
+		t.Fatalf("unexpected error on second publish: %s", err)
+	}
+
+	m, ok := sink.maps["expvarsinktest"]
+	if !ok {
+		t.Fatalf("expected map to be tracked for component")
+	}
+	if got := m.Get("requests").String(); got != "2" {
+		t.Errorf("expected requests to be 2, got %s", got)
+	}
+}
+
+func TestExpvarSinkPublishReusesProcessGlobalMap(t *testing.T) {
+
+	// Simulate a second ExpvarSink instance (e.g. InitDefaultReporter
+	// called twice) publishing under a component name already registered
+	// in expvar's process-global registry by another sink.
+	first := NewExpvarSink()
+	if err := first.Publish("sharedcomponent", map[string]float32{"requests": 1}); err != nil {
+		t.Fatalf("unexpected error from first sink: %s", err)
+	}
+
+	second := NewExpvarSink()
+	if err := second.Publish("sharedcomponent", map[string]float32{"requests": 1}); err != nil {
+		t.Fatalf("unexpected error from second sink: %s", err)
+	}
+}
@@ -1,18 +1,34 @@
 package simplerelic
 
 import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
 	"sync"
 	"time"
-
-	"github.com/gin-gonic/gin"
 )
 
+// RequestInfo is a framework-agnostic description of a single handled
+// HTTP request. AppMetric implementations only ever see a RequestInfo,
+// so they don't need to depend on Gin (or any other framework) directly;
+// framework adapters (the Gin Handler middleware and its siblings in
+// the nethttp and chi packages) are responsible for building one.
+type RequestInfo struct {
+	Method        string
+	Path          string
+	RouteTemplate string
+	Status        int
+	Duration      time.Duration
+	Err           error
+}
+
 // AppMetric is an interface for metrics reported to NewRelic
 type AppMetric interface {
 
 	// Update all the values that will be reported (or be used in calculation)
-	// Called on every requests (used in gin middleware)
-	Update(c *gin.Context)
+	// Called once per handled request, with a RequestInfo describing it
+	Update(info RequestInfo)
 
 	// ValueMap extracts all values from AppMetric data structures
 	// to be reported to NewRelic. A single AppMetric can produce multiple
@@ -24,6 +40,11 @@ type AppMetric interface {
 
 const (
 	unknownEndpoint = "other"
+
+	// defaultMaxRoutes caps the number of distinct route templates a
+	// route-based metric (see NewReqPerRoute and friends) will track
+	// before collapsing any further new routes into unknownEndpoint.
+	defaultMaxRoutes = 500
 )
 
 // StandardMetric is a base for metrics dealing with endpoints
@@ -34,6 +55,15 @@ type StandardMetric struct {
 	namePrefix      string
 	allEPNamePrefix string
 	metricUnit      string
+
+	// routeBased, maxRoutes and registerRoute support the
+	// NewXxxPerRoute family of constructors, which resolve the
+	// endpoint from the request's route template (RequestInfo.RouteTemplate)
+	// instead of a user-supplied matcher and lazily start tracking routes as
+	// they're first seen.
+	routeBased    bool
+	maxRoutes     int
+	registerRoute func(route string)
 }
 
 func (m *StandardMetric) initReqCount() {
@@ -56,6 +86,58 @@ func (m *StandardMetric) endpointFromURL(urlPath string) string {
 	return unknownEndpoint
 }
 
+// resolveEndpoint resolves the endpoint/route name for a request.
+// Route-based metrics use the request's route template (as reported by
+// the framework adapter), lazily starting to track any template not yet
+// seen, up to maxRoutes, beyond which new templates collapse into
+// unknownEndpoint. Other metrics fall back to the classic, user-supplied
+// matcher functions.
+func (m *StandardMetric) resolveEndpoint(info RequestInfo) string {
+	if !m.routeBased {
+		return m.endpointFromURL(info.Path)
+	}
+
+	route := info.RouteTemplate
+	if route == "" {
+		return unknownEndpoint
+	}
+
+	m.lock.RLock()
+	_, tracked := m.reqCount[route]
+	m.lock.RUnlock()
+	if tracked {
+		return route
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, tracked := m.reqCount[route]; tracked {
+		return route
+	}
+
+	// unknownEndpoint is always present and doesn't count against the cap
+	if len(m.reqCount)-1 >= m.maxRoutes {
+		return unknownEndpoint
+	}
+
+	m.reqCount[route] = 0
+	if m.registerRoute != nil {
+		m.registerRoute(route)
+	}
+
+	return route
+}
+
+// resolveMaxRoutes returns the configured max routes, defaulting to
+// defaultMaxRoutes when none (or a non-positive one) was given
+func resolveMaxRoutes(maxRoutes []int) int {
+	if len(maxRoutes) > 0 && maxRoutes[0] > 0 {
+		return maxRoutes[0]
+	}
+	return defaultMaxRoutes
+}
+
 /************************************
  * requests per endpoint
  ***********************************/
@@ -83,9 +165,32 @@ func NewReqPerEndpoint(endpoints map[string]func(urlPath string) bool) *ReqPerEn
 	return metric
 }
 
+// NewReqPerRoute creates a ReqPerEndpoint that tracks requests per route
+// template (e.g. Gin's c.FullPath()) instead of requiring AddDefaultEndpoint
+// matchers. maxRoutes optionally caps the number of tracked routes
+// (default defaultMaxRoutes).
+func NewReqPerRoute(maxRoutes ...int) *ReqPerEndpoint {
+
+	metric := &ReqPerEndpoint{
+		StandardMetric: &StandardMetric{
+			endpoints:       make(map[string]func(urlPath string) bool),
+			reqCount:        make(map[string]int),
+			namePrefix:      "Component/ReqPerEndpoint/",
+			allEPNamePrefix: "Component/Req/overall",
+			metricUnit:      "[requests]",
+			routeBased:      true,
+			maxRoutes:       resolveMaxRoutes(maxRoutes),
+		},
+	}
+
+	metric.initReqCount()
+
+	return metric
+}
+
 // Update the metric values
-func (m *ReqPerEndpoint) Update(c *gin.Context) {
-	endpointName := m.endpointFromURL(c.Request.URL.Path)
+func (m *ReqPerEndpoint) Update(info RequestInfo) {
+	endpointName := m.resolveEndpoint(info)
 	m.lock.Lock()
 	m.reqCount[endpointName]++
 	m.lock.Unlock()
@@ -143,11 +248,39 @@ func NewErrorRatePerEndpoint(endpoints map[string]func(urlPath string) bool) *Er
 	return metric
 }
 
+// NewErrorRatePerRoute creates an ErrorRatePerEndpoint that tracks the
+// error rate per route template (e.g. Gin's c.FullPath()) instead of requiring
+// AddDefaultEndpoint matchers. maxRoutes optionally caps the number of
+// tracked routes (default defaultMaxRoutes).
+func NewErrorRatePerRoute(maxRoutes ...int) *ErrorRatePerEndpoint {
+
+	metric := &ErrorRatePerEndpoint{
+		StandardMetric: &StandardMetric{
+			endpoints:       make(map[string]func(urlPath string) bool),
+			reqCount:        make(map[string]int),
+			namePrefix:      "Component/ErrorRatePerEndpoint/",
+			allEPNamePrefix: "Component/ErrorRate/overall",
+			metricUnit:      "[percent]",
+			routeBased:      true,
+			maxRoutes:       resolveMaxRoutes(maxRoutes),
+		},
+		errorCount: make(map[string]int),
+	}
+
+	metric.initReqCount()
+	metric.errorCount[unknownEndpoint] = 0
+	metric.registerRoute = func(route string) {
+		metric.errorCount[route] = 0
+	}
+
+	return metric
+}
+
 // Update the metric values
-func (m *ErrorRatePerEndpoint) Update(c *gin.Context) {
-	endpointName := m.endpointFromURL(c.Request.URL.Path)
+func (m *ErrorRatePerEndpoint) Update(info RequestInfo) {
+	endpointName := m.resolveEndpoint(info)
 	m.lock.Lock()
-	if c.Writer.Status() >= 400 {
+	if info.Status >= 400 {
 		m.errorCount[endpointName]++
 	}
 	m.reqCount[endpointName]++
@@ -222,18 +355,41 @@ func NewResponseTimePerEndpoint(endpoints map[string]func(urlPath string) bool)
 	return metric
 }
 
-// Update the metric values
-func (m *ResponseTimePerEndpoint) Update(c *gin.Context) {
+// NewResponseTimePerRoute creates a ResponseTimePerEndpoint that tracks
+// response time per route template (e.g. Gin's c.FullPath()) instead of
+// requiring AddDefaultEndpoint matchers. maxRoutes optionally caps the
+// number of tracked routes (default defaultMaxRoutes).
+func NewResponseTimePerRoute(maxRoutes ...int) *ResponseTimePerEndpoint {
 
-	startTime, err := c.Get("reqStartTime")
-	if err != nil {
-		Log.Printf("reqStart time should be time.Time")
-		return
+	metric := &ResponseTimePerEndpoint{
+		StandardMetric: &StandardMetric{
+			endpoints:       make(map[string]func(urlPath string) bool),
+			reqCount:        make(map[string]int),
+			namePrefix:      "Component/ResponseTimePerEndpoint/",
+			allEPNamePrefix: "Component/ResponseTime/overall",
+			metricUnit:      "[ms]",
+			routeBased:      true,
+			maxRoutes:       resolveMaxRoutes(maxRoutes),
+		},
+
+		responseTime: make(map[string][]float32),
 	}
 
-	elaspsedTimeInMs := float32(time.Since(startTime.(time.Time))) / float32(time.Millisecond)
+	metric.initReqCount()
+	metric.responseTime[unknownEndpoint] = make([]float32, 1)
+	metric.registerRoute = func(route string) {
+		metric.responseTime[route] = make([]float32, 1)
+	}
+
+	return metric
+}
 
-	endpointName := m.endpointFromURL(c.Request.URL.Path)
+// Update the metric values
+func (m *ResponseTimePerEndpoint) Update(info RequestInfo) {
+
+	elaspsedTimeInMs := float32(info.Duration) / float32(time.Millisecond)
+
+	endpointName := m.resolveEndpoint(info)
 	m.lock.Lock()
 	m.reqCount[endpointName]++
 	m.responseTime[endpointName] = append(m.responseTime[endpointName], elaspsedTimeInMs)
@@ -277,3 +433,239 @@ func (m *ResponseTimePerEndpoint) ValueMap() map[string]float32 {
 
 	return metrics
 }
+
+/**************************************************
+* Response time histogram per endpoint
+**************************************************/
+
+// reservoirSize is the number of samples kept per endpoint between
+// flushes, so memory use stays bounded no matter the traffic volume.
+const reservoirSize = 1024
+
+// reservoir is a fixed-size reservoir sample of response times, built
+// using Algorithm R: the first reservoirSize values are kept outright,
+// every value after that replaces a uniformly-chosen slot with
+// probability reservoirSize/count.
+type reservoir struct {
+	samples []float32
+	count   int
+}
+
+func (r *reservoir) add(value float32) {
+	r.count++
+	if len(r.samples) < reservoirSize {
+		r.samples = append(r.samples, value)
+		return
+	}
+	if j := rand.Intn(r.count); j < reservoirSize {
+		r.samples[j] = value
+	}
+}
+
+func (r *reservoir) reset() {
+	r.samples = r.samples[:0]
+	r.count = 0
+}
+
+// percentile returns the value at quantile q (0,1] from a sorted slice
+// using the nearest-rank method.
+func percentile(sorted []float32, q float32) float32 {
+	if len(sorted) == 0 {
+		return 0.
+	}
+
+	rank := int(math.Ceil(float64(q)*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+
+	return sorted[rank]
+}
+
+// ResponseTimeHistogramPerEndpoint tracks the response time distribution
+// per endpoint (min, max, count and p50/p95/p99 quantiles) using a
+// bounded reservoir sample, unlike ResponseTimePerEndpoint which keeps
+// every sample in an unbounded slice between flushes.
+type ResponseTimeHistogramPerEndpoint struct {
+	*StandardMetric
+	reservoirs map[string]*reservoir
+}
+
+// NewResponseTimeHistogramPerEndpoint creates new ResponseTimeHistogramPerEndpoint metric
+func NewResponseTimeHistogramPerEndpoint(endpoints map[string]func(urlPath string) bool) *ResponseTimeHistogramPerEndpoint {
+
+	metric := &ResponseTimeHistogramPerEndpoint{
+		StandardMetric: &StandardMetric{
+			endpoints:  endpoints,
+			reqCount:   make(map[string]int),
+			namePrefix: "Component/ResponseTimePerEndpoint/",
+			metricUnit: "[ms]",
+		},
+
+		reservoirs: make(map[string]*reservoir),
+	}
+
+	// initialize the metrics
+	metric.initReqCount()
+	for endpoint := range metric.endpoints {
+		metric.reservoirs[endpoint] = &reservoir{}
+	}
+	metric.reservoirs[unknownEndpoint] = &reservoir{}
+
+	return metric
+}
+
+// Update the metric values
+func (m *ResponseTimeHistogramPerEndpoint) Update(info RequestInfo) {
+
+	elaspsedTimeInMs := float32(info.Duration) / float32(time.Millisecond)
+
+	endpointName := m.resolveEndpoint(info)
+	m.lock.Lock()
+	m.reservoirs[endpointName].add(elaspsedTimeInMs)
+	m.lock.Unlock()
+}
+
+// ValueMap extract all the metrics to be reported
+func (m *ResponseTimeHistogramPerEndpoint) ValueMap() map[string]float32 {
+
+	metrics := make(map[string]float32)
+
+	m.lock.Lock()
+	for endpoint, r := range m.reservoirs {
+		prefix := m.namePrefix + endpoint + "/"
+
+		samples := make([]float32, len(r.samples))
+		copy(samples, r.samples)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+		metrics[prefix+"count"+m.metricUnit] = float32(r.count)
+		metrics[prefix+"min"+m.metricUnit] = 0.
+		metrics[prefix+"max"+m.metricUnit] = 0.
+		if len(samples) > 0 {
+			metrics[prefix+"min"+m.metricUnit] = samples[0]
+			metrics[prefix+"max"+m.metricUnit] = samples[len(samples)-1]
+		}
+		metrics[prefix+"p50"+m.metricUnit] = percentile(samples, 0.5)
+		metrics[prefix+"p95"+m.metricUnit] = percentile(samples, 0.95)
+		metrics[prefix+"p99"+m.metricUnit] = percentile(samples, 0.99)
+
+		r.reset()
+	}
+	m.lock.Unlock()
+
+	return metrics
+}
+
+/**************************************************
+* Status class per endpoint
+**************************************************/
+
+// statusClasses are the HTTP response status classes tracked per endpoint
+var statusClasses = []string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+
+// classForStatus returns the status class (e.g. 404 -> "4xx") for a status code
+func classForStatus(status int) string {
+	class := status / 100
+	if class < 1 || class > 5 {
+		return unknownEndpoint
+	}
+	return fmt.Sprintf("%dxx", class)
+}
+
+func newClassCount() map[string]int {
+	count := make(map[string]int)
+	for _, class := range statusClasses {
+		count[class] = 0
+	}
+	return count
+}
+
+// StatusClassPerEndpoint holds the percentage of requests per response
+// status class (2xx/3xx/4xx/5xx, ...) per endpoint
+type StatusClassPerEndpoint struct {
+	*StandardMetric
+	classCount map[string]map[string]int
+}
+
+// NewStatusClassPerEndpoint creates new StatusClassPerEndpoint metric
+func NewStatusClassPerEndpoint(endpoints map[string]func(urlPath string) bool) *StatusClassPerEndpoint {
+
+	metric := &StatusClassPerEndpoint{
+		StandardMetric: &StandardMetric{
+			endpoints:       endpoints,
+			reqCount:        make(map[string]int),
+			namePrefix:      "Component/StatusClassPerEndpoint/",
+			allEPNamePrefix: "Component/StatusClass/overall",
+			metricUnit:      "[percent]",
+		},
+		classCount: make(map[string]map[string]int),
+	}
+
+	// initialize the metrics
+	metric.initReqCount()
+	for endpoint := range metric.endpoints {
+		metric.classCount[endpoint] = newClassCount()
+	}
+	metric.classCount[unknownEndpoint] = newClassCount()
+
+	return metric
+}
+
+// Update the metric values
+func (m *StatusClassPerEndpoint) Update(info RequestInfo) {
+	endpointName := m.resolveEndpoint(info)
+	class := classForStatus(info.Status)
+
+	m.lock.Lock()
+	m.reqCount[endpointName]++
+	if _, ok := m.classCount[endpointName][class]; ok {
+		m.classCount[endpointName][class]++
+	}
+	m.lock.Unlock()
+}
+
+// ValueMap extract all the metrics to be reported
+func (m *StatusClassPerEndpoint) ValueMap() map[string]float32 {
+
+	metrics := make(map[string]float32)
+
+	m.lock.Lock()
+
+	var allEPReq int
+	allEPClassCount := newClassCount()
+
+	for endpoint, count := range m.classCount {
+		reqForEndpoint := m.reqCount[endpoint]
+
+		for _, class := range statusClasses {
+			metricName := m.namePrefix + endpoint + "/" + class + m.metricUnit
+
+			metrics[metricName] = 0.
+			if reqForEndpoint > 0 {
+				metrics[metricName] = float32(count[class]) / float32(reqForEndpoint)
+			}
+
+			allEPClassCount[class] += count[class]
+			count[class] = 0
+		}
+
+		allEPReq += reqForEndpoint
+		m.reqCount[endpoint] = 0
+	}
+
+	for _, class := range statusClasses {
+		metricName := m.allEPNamePrefix + "/" + class + m.metricUnit
+
+		metrics[metricName] = 0.
+		if allEPReq > 0 {
+			metrics[metricName] = float32(allEPClassCount[class]) / float32(allEPReq)
+		}
+	}
+
+	m.lock.Unlock()
+
+	return metrics
+}
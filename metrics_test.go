@@ -77,7 +77,7 @@ func TestReq(t *testing.T) {
 	m := NewReqPerEndpoint(DefaultEndpoints)
 
 	r.GET("/log", func(c *gin.Context) {
-		m.Update(c)
+		m.Update(requestInfoFromGin(c))
 	})
 
 	r.ServeHTTP(recorder, req)
@@ -106,11 +106,11 @@ func TestErrorRate(t *testing.T) {
 	r.GET("/log", func(c *gin.Context) {
 		for i := 0; i < 4; i++ {
 			c.Writer.WriteHeader(404)
-			m.Update(c)
+			m.Update(requestInfoFromGin(c))
 		}
 		for i := 0; i < 4; i++ {
 			c.Writer.WriteHeader(200)
-			m.Update(c)
+			m.Update(requestInfoFromGin(c))
 		}
 	})
 
@@ -160,3 +160,118 @@ func TestResponseTimeValueMap(t *testing.T) {
 	checkCalc(t, values, 0.15)
 	checkIsCleared(t, m)
 }
+
+func TestResponseTimeHistogramValueMap(t *testing.T) {
+
+	setup()
+
+	m := NewResponseTimeHistogramPerEndpoint(DefaultEndpoints)
+
+	r.GET("/log", func(c *gin.Context) {
+		for i := 1; i <= 100; i++ {
+			m.reservoirs[endpointName].add(float32(i))
+		}
+	})
+
+	r.ServeHTTP(recorder, req)
+
+	values := m.ValueMap()
+
+	if values["Component/ResponseTimePerEndpoint/"+endpointName+"/count[ms]"] != 100 {
+		t.Errorf("error: expected count of 100, got %f", values["Component/ResponseTimePerEndpoint/"+endpointName+"/count[ms]"])
+	}
+
+	if values["Component/ResponseTimePerEndpoint/"+endpointName+"/min[ms]"] != 1 {
+		t.Errorf("error: expected min of 1, got %f", values["Component/ResponseTimePerEndpoint/"+endpointName+"/min[ms]"])
+	}
+
+	if values["Component/ResponseTimePerEndpoint/"+endpointName+"/max[ms]"] != 100 {
+		t.Errorf("error: expected max of 100, got %f", values["Component/ResponseTimePerEndpoint/"+endpointName+"/max[ms]"])
+	}
+
+	if values["Component/ResponseTimePerEndpoint/"+endpointName+"/p50[ms]"] != 50 {
+		t.Errorf("error: expected p50 of 50, got %f", values["Component/ResponseTimePerEndpoint/"+endpointName+"/p50[ms]"])
+	}
+
+	// reservoir should be cleared after ValueMap
+	if m.reservoirs[endpointName].count != 0 {
+		t.Errorf("error: expected reservoir to be reset")
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+
+	setup()
+
+	m := NewStatusClassPerEndpoint(DefaultEndpoints)
+
+	r.GET("/log", func(c *gin.Context) {
+		for i := 0; i < 2; i++ {
+			c.Writer.WriteHeader(200)
+			m.Update(requestInfoFromGin(c))
+		}
+		for i := 0; i < 2; i++ {
+			c.Writer.WriteHeader(500)
+			m.Update(requestInfoFromGin(c))
+		}
+	})
+
+	r.ServeHTTP(recorder, req)
+
+	values := m.ValueMap()
+
+	if values["Component/StatusClassPerEndpoint/"+endpointName+"/2xx[percent]"] != 0.5 {
+		t.Errorf("error: expected 0.5, got %f", values["Component/StatusClassPerEndpoint/"+endpointName+"/2xx[percent]"])
+	}
+
+	if values["Component/StatusClassPerEndpoint/"+endpointName+"/5xx[percent]"] != 0.5 {
+		t.Errorf("error: expected 0.5, got %f", values["Component/StatusClassPerEndpoint/"+endpointName+"/5xx[percent]"])
+	}
+
+	if values["Component/StatusClass/overall/2xx[percent]"] != 0.5 {
+		t.Errorf("error: expected 0.5, got %f", values["Component/StatusClass/overall/2xx[percent]"])
+	}
+
+	checkIsCleared(t, m)
+}
+
+func TestReqPerRoute(t *testing.T) {
+
+	m := NewReqPerRoute()
+
+	r = gin.New()
+	r.GET("/users/:id", func(c *gin.Context) {
+		m.Update(requestInfoFromGin(c))
+	})
+
+	req, _ := http.NewRequest("GET", "/users/42", nil)
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
+
+	values := m.ValueMap()
+	if values["Component/ReqPerEndpoint//users/:id[requests]"] != 1 {
+		t.Errorf("error: expected 1 request on route /users/:id, got %v", values)
+	}
+}
+
+func TestReqPerRouteMaxRoutes(t *testing.T) {
+
+	m := NewReqPerRoute(1)
+
+	r = gin.New()
+	r.GET("/a", func(c *gin.Context) { m.Update(requestInfoFromGin(c)) })
+	r.GET("/b", func(c *gin.Context) { m.Update(requestInfoFromGin(c)) })
+
+	reqA, _ := http.NewRequest("GET", "/a", nil)
+	r.ServeHTTP(httptest.NewRecorder(), reqA)
+	reqB, _ := http.NewRequest("GET", "/b", nil)
+	r.ServeHTTP(httptest.NewRecorder(), reqB)
+
+	values := m.ValueMap()
+	if values["Component/ReqPerEndpoint//a[requests]"] != 1 {
+		t.Errorf("error: expected the first route to be tracked, got %v", values)
+	}
+	if values["Component/ReqPerEndpoint/other[requests]"] != 1 {
+		t.Errorf("error: expected overflow route collapsed into \"other\", got %v", values)
+	}
+}
@@ -0,0 +1,44 @@
+// Package nethttp adapts simplerelic metrics to plain net/http handlers,
+// for users who don't want to pull in Gin.
+package nethttp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/domenp/simplerelic"
+)
+
+// statusRecorder wraps http.ResponseWriter to capture the status code
+// written, since net/http doesn't expose it directly.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware wraps an http.Handler, updating simplerelic.SimpleReporter's
+// metrics after each request the way simplerelic.Handler does for Gin.
+// net/http has no notion of a route template, so route-based metrics
+// (e.g. simplerelic.NewReqPerRoute) will see every request collapse into
+// the "other" bucket; use the classic AddDefaultEndpoint matchers instead.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		simplerelic.SimpleReporter.Update(simplerelic.RequestInfo{
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Status:   rec.status,
+			Duration: time.Since(start),
+		})
+	})
+}
@@ -0,0 +1,83 @@
+package nethttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/domenp/simplerelic"
+)
+
+func TestMiddlewareCapturesStatus(t *testing.T) {
+
+	reporter, err := simplerelic.NewReporter("nethttptest", "fake-licence", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating reporter: %s", err)
+	}
+	metric := simplerelic.NewReqPerEndpoint(map[string]func(string) bool{
+		"widgets": func(urlPath string) bool { return urlPath == "/widgets" },
+	})
+	reporter.AddMetric(metric)
+	simplerelic.SimpleReporter = reporter
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	req := httptest.NewRequest("GET", "/widgets", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("expected the wrapped handler's status to pass through, got %d", rec.Code)
+	}
+
+	values := metric.ValueMap()
+	if values["Component/ReqPerEndpoint/widgets[requests]"] != 1 {
+		t.Errorf("expected widgets endpoint to be credited, got %v", values)
+	}
+}
+
+func TestMiddlewareDefaultStatusIsOK(t *testing.T) {
+
+	reporter, err := simplerelic.NewReporter("nethttptest2", "fake-licence", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating reporter: %s", err)
+	}
+	simplerelic.SimpleReporter = reporter
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// never calls WriteHeader
+	}))
+
+	req := httptest.NewRequest("GET", "/anything", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected default status 200, got %d", rec.Code)
+	}
+}
+
+func TestMiddlewareHasNoRouteTemplate(t *testing.T) {
+
+	// net/http carries no notion of a matched route template, so a
+	// route-based metric must collapse every request into "other".
+	metric := simplerelic.NewReqPerRoute()
+	reporter, err := simplerelic.NewReporter("nethttptest3", "fake-licence", false)
+	if err != nil {
+		t.Fatalf("unexpected error creating reporter: %s", err)
+	}
+	reporter.AddMetric(metric)
+	simplerelic.SimpleReporter = reporter
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	values := metric.ValueMap()
+	if values["Component/ReqPerEndpoint/other[requests]"] != 1 {
+		t.Errorf("expected route-based metric to collapse into \"other\", got %v", values)
+	}
+}
@@ -0,0 +1,139 @@
+package simplerelic
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metricUnitRe    = regexp.MustCompile(`\[[^\]]*\]$`)
+	metricInvalidRe = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+	metricCaseRe    = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+)
+
+// subMetricSuffixes are the trailing path segments used by metric
+// families that report more than one value per endpoint, e.g.
+// ResponseTimeHistogramPerEndpoint's "count"/"min"/"max"/"p50"/"p95"/"p99"
+// or StatusClassPerEndpoint's "1xx".."5xx". parseMetricName recognises
+// them so it can fold the sub-metric into the Prometheus metric name
+// instead of mistaking it for part of the endpoint, even when the
+// endpoint itself is a route template containing slashes (e.g.
+// "/users/:id").
+var subMetricSuffixes = map[string]bool{
+	"count": true, "min": true, "max": true,
+	"p50": true, "p95": true, "p99": true,
+	"1xx": true, "2xx": true, "3xx": true, "4xx": true, "5xx": true,
+}
+
+// parseMetricName translates a NewRelic style metric name such as
+// "Component/ReqPerEndpoint//users/:id[requests]" into a Prometheus
+// metric name ("req_per_endpoint") and, for metrics broken down per
+// endpoint or route, the endpoint label value ("/users/:id"). Metric
+// families with a sub-metric per endpoint (see subMetricSuffixes) fold
+// the sub-metric into the name instead, e.g.
+// "Component/ResponseTimePerEndpoint/log/p99[ms]" becomes
+// "response_time_per_endpoint_p99" labelled "log".
+func parseMetricName(name string) (metricName string, endpoint string) {
+
+	name = metricUnitRe.ReplaceAllString(name, "")
+	name = strings.TrimPrefix(name, "Component/")
+
+	sepIdx := strings.Index(name, "/")
+	if sepIdx < 0 {
+		return toSnakeCase(name), ""
+	}
+
+	family, rest := name[:sepIdx], name[sepIdx+1:]
+	if !strings.HasSuffix(family, "PerEndpoint") && !strings.HasSuffix(family, "PerRoute") {
+		return toSnakeCase(strings.Join(strings.Split(name, "/"), "_")), ""
+	}
+
+	metricName = toSnakeCase(family)
+	endpoint = rest
+	if i := strings.LastIndex(rest, "/"); i >= 0 && subMetricSuffixes[rest[i+1:]] {
+		endpoint = rest[:i]
+		metricName += "_" + toSnakeCase(rest[i+1:])
+	}
+
+	return metricName, endpoint
+}
+
+// toSnakeCase sanitises a name into the form expected of a Prometheus
+// metric or label: lower_snake_case, alphanumerics and underscores only.
+func toSnakeCase(name string) string {
+	name = metricCaseRe.ReplaceAllString(name, "${1}_${2}")
+	name = metricInvalidRe.ReplaceAllString(name, "_")
+	return strings.Trim(strings.ToLower(name), "_")
+}
+
+// PrometheusSink publishes metrics as Prometheus gauges, one GaugeVec
+// per distinct metric name, labelled by endpoint where applicable.
+type PrometheusSink struct {
+	registry *prometheus.Registry
+	lock     sync.Mutex
+	gauges   map[string]*prometheus.GaugeVec
+}
+
+// NewPrometheusSink creates a new PrometheusSink. Pass nil to let it
+// create its own registry, or pass a registry shared with the rest of
+// the application.
+func NewPrometheusSink(registry *prometheus.Registry) *PrometheusSink {
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
+
+	return &PrometheusSink{
+		registry: registry,
+		gauges:   make(map[string]*prometheus.GaugeVec),
+	}
+}
+
+// Publish updates the Prometheus gauges for the given metrics
+func (sink *PrometheusSink) Publish(component string, metrics map[string]float32) error {
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	for name, value := range metrics {
+		metricName, endpoint := parseMetricName(name)
+		if metricName == "" {
+			continue
+		}
+
+		gauge, ok := sink.gauges[metricName]
+		if !ok {
+			labels := []string{}
+			if endpoint != "" {
+				labels = []string{"endpoint"}
+			}
+
+			gauge = prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{Name: metricName, Help: name},
+				labels,
+			)
+			if err := sink.registry.Register(gauge); err != nil {
+				return fmt.Errorf("error registering prometheus metric %s: %s", metricName, err)
+			}
+			sink.gauges[metricName] = gauge
+		}
+
+		if endpoint != "" {
+			gauge.WithLabelValues(endpoint).Set(float64(value))
+		} else {
+			gauge.WithLabelValues().Set(float64(value))
+		}
+	}
+
+	return nil
+}
+
+// Handler returns the http.Handler that serves /metrics for this sink's registry
+func (sink *PrometheusSink) Handler() http.Handler {
+	return promhttp.HandlerFor(sink.registry, promhttp.HandlerOpts{})
+}
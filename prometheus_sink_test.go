@@ -0,0 +1,115 @@
+package simplerelic
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestParseMetricName(t *testing.T) {
+
+	cases := []struct {
+		name         string
+		wantMetric   string
+		wantEndpoint string
+	}{
+		{"Component/Req/overall[requests]", "req_overall", ""},
+		{"Component/ReqPerEndpoint/log[requests]", "req_per_endpoint", "log"},
+		{"Component/ReqPerEndpoint//users/:id[requests]", "req_per_endpoint", "/users/:id"},
+		{"Component/ResponseTimePerEndpoint/log/p99[ms]", "response_time_per_endpoint_p99", "log"},
+		{"Component/ResponseTimePerEndpoint//users/:id/count[ms]", "response_time_per_endpoint_count", "/users/:id"},
+		{"Component/StatusClassPerEndpoint/log/2xx[percent]", "status_class_per_endpoint_2xx", "log"},
+		{"Component/StatusClass/overall/2xx[percent]", "status_class_overall_2xx", ""},
+	}
+
+	for _, c := range cases {
+		metricName, endpoint := parseMetricName(c.name)
+		if metricName != c.wantMetric || endpoint != c.wantEndpoint {
+			t.Errorf("parseMetricName(%q) = (%q, %q), want (%q, %q)",
+				c.name, metricName, endpoint, c.wantMetric, c.wantEndpoint)
+		}
+	}
+}
+
+func TestToSnakeCase(t *testing.T) {
+
+	cases := map[string]string{
+		"ReqPerEndpoint": "req_per_endpoint",
+		"log":            "log",
+		"2xx":            "2xx",
+		"/users/:id":     "users_id",
+	}
+
+	for in, want := range cases {
+		if got := toSnakeCase(in); got != want {
+			t.Errorf("toSnakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPrometheusSinkPublish(t *testing.T) {
+
+	sink := NewPrometheusSink(nil)
+
+	metrics := map[string]float32{
+		"Component/ReqPerEndpoint/log[requests]":            3,
+		"Component/ReqPerEndpoint/checkout[requests]":       7,
+		"Component/Req/overall[requests]":                   10,
+		"Component/StatusClassPerEndpoint/log/2xx[percent]": 0.5,
+	}
+
+	if err := sink.Publish("myapp", metrics); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	families, err := sink.registry.Gather()
+	if err != nil {
+		t.Fatalf("gather failed: %s", err)
+	}
+
+	byName := make(map[string]*dto.MetricFamily)
+	for _, f := range families {
+		byName[f.GetName()] = f
+	}
+
+	reqPerEndpoint, ok := byName["req_per_endpoint"]
+	if !ok {
+		t.Fatalf("expected a single req_per_endpoint metric family, got %v", byName)
+	}
+	if len(reqPerEndpoint.Metric) != 2 {
+		t.Errorf("expected 2 label combinations (one per endpoint), got %d", len(reqPerEndpoint.Metric))
+	}
+
+	if _, ok := byName["req_overall"]; !ok {
+		t.Errorf("expected req_overall metric family")
+	}
+
+	if _, ok := byName["status_class_per_endpoint_2xx"]; !ok {
+		t.Errorf("expected status_class_per_endpoint_2xx metric family")
+	}
+}
+
+func TestPrometheusSinkPublishReusesGauge(t *testing.T) {
+
+	sink := NewPrometheusSink(nil)
+
+	if err := sink.Publish("myapp", map[string]float32{"Component/ReqPerEndpoint/log[requests]": 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := sink.Publish("myapp", map[string]float32{"Component/ReqPerEndpoint/log[requests]": 2}); err != nil {
+		t.Fatalf("unexpected error on second publish: %s", err)
+	}
+
+	if len(sink.gauges) != 1 {
+		t.Errorf("expected a single registered gauge across both publishes, got %d", len(sink.gauges))
+	}
+
+	gauge := sink.gauges["req_per_endpoint"].WithLabelValues("log")
+	var m dto.Metric
+	if err := gauge.Write(&m); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+	if m.GetGauge().GetValue() != 2 {
+		t.Errorf("expected gauge to be updated in place, got %f", m.GetGauge().GetValue())
+	}
+}
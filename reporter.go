@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -24,8 +26,28 @@ const (
 
 	// for debugging purposes sending metrics can be disabled
 	sendMetrics = true
+
+	// maxQueuedPayloads bounds how many failed batches NewRelicSink
+	// keeps around to retry on the next publish, so a recovering
+	// endpoint gets the backlog instead of only the newest sample.
+	maxQueuedPayloads = 10
 )
 
+// RetryPolicy controls the backoff NewRelicSink uses when a POST to
+// NewRelic fails with a network error, a 5xx or a 429.
+type RetryPolicy struct {
+	Base        time.Duration
+	Cap         time.Duration
+	MaxAttempts int
+}
+
+// DefaultRetryPolicy is used by NewRelicSink unless overridden with WithRetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	Base:        500 * time.Millisecond,
+	Cap:         30 * time.Second,
+	MaxAttempts: 5,
+}
+
 var (
 	// Log is a logger used in the package
 	Log *log.Logger
@@ -36,17 +58,21 @@ func init() {
 	Log = log.New(os.Stderr, "simplerelic:", log.Lshortfile)
 }
 
-// Reporter keeps track of the app metrics and sends them to NewRelic
+// Sink is implemented by a destination that collected metrics can be
+// published to, e.g. NewRelic, Prometheus or expvar.
+type Sink interface {
+
+	// Publish sends the metrics collected for a component (the app
+	// name) to the sink. It is called once per reporting interval.
+	Publish(component string, metrics map[string]float32) error
+}
+
+// Reporter keeps track of the app metrics and publishes them to its sinks
 type Reporter struct {
-	metrics  []AppMetric
-	host     string
-	pid      int
-	guid     string
-	duration int
-	version  string
-	appName  string
-	licence  string
-	verbose  bool
+	metrics []AppMetric
+	sinks   []Sink
+	appName string
+	verbose bool
 }
 
 type newRelicData struct {
@@ -67,36 +93,26 @@ type newRelicComponent struct {
 	Metrics  map[string]float32 `json:"metrics"`
 }
 
-// NewReporter creates a new Reporter
+// NewReporter creates a new Reporter that publishes to NewRelic.
+// Additional sinks can be registered with AddSink.
 func NewReporter(appName string, licence string, verbose bool) (*Reporter, error) {
 
-	host, err := os.Hostname()
+	newRelicSink, err := NewNewRelicSink(licence, verbose)
 	if err != nil {
-		return nil, errors.New("Can not get hostname")
-	}
-
-	pid := os.Getpid()
-
-	if licence == "" {
-		return nil, errors.New("Please specify Newrelic licence")
+		return nil, err
 	}
 
 	reporter := &Reporter{
-		host:     host,
-		pid:      pid,
-		guid:     Guid,
-		duration: 60,
-		appName:  appName,
-		licence:  licence,
-		version:  "1.0.0",
-		verbose:  verbose,
-		metrics:  make([]AppMetric, 0, 5),
+		appName: appName,
+		verbose: verbose,
+		metrics: make([]AppMetric, 0, 5),
+		sinks:   []Sink{newRelicSink},
 	}
 
 	return reporter, nil
 }
 
-// Start sending metrics to NewRelic
+// Start sending metrics to the configured sinks
 func (reporter *Reporter) Start() {
 
 	ticker := time.NewTicker(reportingFreq)
@@ -126,88 +142,262 @@ func (reporter *Reporter) AddMetric(metric AppMetric) {
 	reporter.metrics = append(reporter.metrics, metric)
 }
 
-// extract and send metrics to NewRelic
+// Update applies a single handled request to every registered metric.
+// Framework adapters (the Gin Handler middleware and its siblings in
+// the nethttp and chi packages) call this once per request.
+func (reporter *Reporter) Update(info RequestInfo) {
+	for _, metric := range reporter.metrics {
+		metric.Update(info)
+	}
+}
+
+// AddSink registers an additional destination that metrics are published to
+func (reporter *Reporter) AddSink(sink Sink) {
+	reporter.sinks = append(reporter.sinks, sink)
+}
+
+// WithRetryPolicy overrides the backoff parameters used by any
+// NewRelicSink already registered on the reporter
+func (reporter *Reporter) WithRetryPolicy(policy RetryPolicy) *Reporter {
+	for _, sink := range reporter.sinks {
+		if newRelicSink, ok := sink.(*NewRelicSink); ok {
+			newRelicSink.WithRetryPolicy(policy)
+		}
+	}
+	return reporter
+}
+
+// extract metrics from the AppMetric data structures and publish them to all sinks
 func (reporter *Reporter) sendMetrics() {
 
-	reqData := reporter.prepareReqData()
+	metrics := make(map[string]float32)
+	for _, metric := range reporter.metrics {
+		for name, value := range metric.ValueMap() {
+			metrics[name] = value
+		}
+	}
 
-	// extract all metrics to be sent to NewRelic
-	// from the AppMetric data structure
-	for _, metrics := range reporter.metrics {
-		for name, value := range metrics.ValueMap() {
-			reqData.Components[0].Metrics[name] = value
+	if reporter.verbose {
+		Log.Println("publishing metrics")
+		Log.Println(metrics)
+	}
+
+	for _, sink := range reporter.sinks {
+		if err := sink.Publish(reporter.appName, metrics); err != nil {
+			Log.Printf("error publishing metrics: %s", err)
 		}
 	}
+}
+
+// NewRelicSink publishes metrics to NewRelic's plugin platform API
+type NewRelicSink struct {
+	host        string
+	pid         int
+	guid        string
+	duration    int
+	version     string
+	licence     string
+	verbose     bool
+	retryPolicy RetryPolicy
+
+	// url is the endpoint doRequest POSTs to. It is always newrelicURL
+	// outside of tests, which override it to point at a local server.
+	url string
+
+	queueLock sync.Mutex
+	queue     [][]byte
+	flushing  bool
+}
+
+// NewNewRelicSink creates a new NewRelicSink
+func NewNewRelicSink(licence string, verbose bool) (*NewRelicSink, error) {
 
-	json, err := json.Marshal(reqData)
+	host, err := os.Hostname()
 	if err != nil {
-		fmt.Errorf("error marshaling json")
+		return nil, errors.New("Can not get hostname")
 	}
 
-	if reporter.verbose {
+	if licence == "" {
+		return nil, errors.New("Please specify Newrelic licence")
+	}
+
+	sink := &NewRelicSink{
+		host:        host,
+		pid:         os.Getpid(),
+		guid:        Guid,
+		duration:    60,
+		licence:     licence,
+		version:     "1.0.0",
+		verbose:     verbose,
+		retryPolicy: DefaultRetryPolicy,
+		url:         newrelicURL,
+	}
+
+	return sink, nil
+}
+
+// WithRetryPolicy overrides the backoff parameters used on transient
+// POST failures and returns the sink for chaining.
+func (sink *NewRelicSink) WithRetryPolicy(policy RetryPolicy) *NewRelicSink {
+	sink.retryPolicy = policy
+	return sink
+}
+
+// Publish hands the metrics off to the retry queue and returns without
+// waiting for them to actually reach NewRelic. Retries (with backoff) run
+// in flushQueue on a dedicated goroutine started here, so a sustained NewRelic
+// outage never blocks the caller, which for Reporter is its single ticking
+// goroutine from Start. Failed batches are carried forward and retried on
+// top of whatever Publish enqueues next, up to maxQueuedPayloads.
+func (sink *NewRelicSink) Publish(component string, metrics map[string]float32) error {
+
+	reqData := sink.prepareReqData(component, metrics)
+
+	body, err := json.Marshal(reqData)
+	if err != nil {
+		return fmt.Errorf("error marshaling json: %s", err)
+	}
+
+	if sink.verbose {
 		Log.Println("sending metrics to NewRelic")
-		Log.Println(string(json))
+		Log.Println(string(body))
+	}
+
+	if !sendMetrics {
+		return nil
+	}
+
+	sink.queueLock.Lock()
+	sink.enqueue(body)
+	alreadyFlushing := sink.flushing
+	sink.flushing = true
+	sink.queueLock.Unlock()
+
+	if !alreadyFlushing {
+		go sink.flushQueue()
 	}
 
-	if sendMetrics {
-		reporter.doRequest(json)
+	return nil
+}
+
+// flushQueue takes a snapshot of the retry queue and retries each payload
+// in turn via doRequest, re-enqueuing any that still fail so the next
+// Publish call's flushQueue carries them forward. Only one flushQueue
+// runs at a time per sink; Publish starts it on the first enqueue after
+// the previous flush finished.
+func (sink *NewRelicSink) flushQueue() {
+
+	sink.queueLock.Lock()
+	backlog := sink.queue
+	sink.queue = nil
+	sink.queueLock.Unlock()
+
+	for _, payload := range backlog {
+		if err := sink.doRequest(payload); err != nil {
+			Log.Printf("error publishing metrics to NewRelic: %s", err)
+			sink.queueLock.Lock()
+			sink.enqueue(payload)
+			sink.queueLock.Unlock()
+		}
 	}
+
+	sink.queueLock.Lock()
+	sink.flushing = false
+	sink.queueLock.Unlock()
 }
 
-func (reporter *Reporter) prepareReqData() *newRelicData {
+// enqueue appends payload to the retry queue, dropping the oldest
+// entries once it grows past maxQueuedPayloads. Callers must hold queueLock.
+func (sink *NewRelicSink) enqueue(payload []byte) {
+	sink.queue = append(sink.queue, payload)
+	if len(sink.queue) > maxQueuedPayloads {
+		sink.queue = sink.queue[len(sink.queue)-maxQueuedPayloads:]
+	}
+}
+
+func (sink *NewRelicSink) prepareReqData(component string, metrics map[string]float32) *newRelicData {
 	reqData := &newRelicData{
 		Agent: &newRelicAgent{
-			Host:    reporter.host,
-			Pid:     reporter.pid,
-			Version: reporter.version,
+			Host:    sink.host,
+			Pid:     sink.pid,
+			Version: sink.version,
 		},
 		Components: []*newRelicComponent{
 			&newRelicComponent{
-				Name:     reporter.appName,
-				Guid:     reporter.guid,
-				Duration: reporter.duration,
-				Metrics:  make(map[string]float32),
+				Name:     component,
+				Guid:     sink.guid,
+				Duration: sink.duration,
+				Metrics:  metrics,
 			},
 		},
 	}
 
-	reqData.Components[0] = &newRelicComponent{
-		Name:     reporter.appName,
-		Guid:     reporter.guid,
-		Duration: reporter.duration,
-		Metrics:  make(map[string]float32),
-	}
-
 	return reqData
 }
 
-func (reporter *Reporter) doRequest(json []byte) {
-	req, err := http.NewRequest("POST", newrelicURL, bytes.NewReader(json))
-	if err != nil {
-		fmt.Errorf("error setting up newrelic request")
-	}
-	req.Header.Set("X-License-Key", reporter.licence)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
+// doRequest POSTs the already-marshalled body to NewRelic, retrying
+// network errors, 5xx and 429 responses with exponential backoff and
+// jitter according to sink.retryPolicy. The body is reused across attempts.
+func (sink *NewRelicSink) doRequest(body []byte) error {
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Errorf("Post request to NewRelic failed")
-		return
-	}
-	defer resp.Body.Close()
+	policy := sink.retryPolicy
 
-	if reporter.verbose {
-		responseJSON, err := ioutil.ReadAll(resp.Body)
+	var lastErr error
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoffWithJitter(policy, attempt))
+		}
+
+		req, err := http.NewRequest("POST", sink.url, bytes.NewReader(body))
 		if err != nil {
-			Log.Println("reading of NewRelic response failed")
+			return fmt.Errorf("error setting up newrelic request: %s", err)
+		}
+		req.Header.Set("X-License-Key", sink.licence)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+
+		client := &http.Client{}
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("post request to NewRelic failed: %s", err)
+			continue
+		}
+
+		if sink.verbose {
+			responseJSON, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				Log.Println("reading of NewRelic response failed")
+			}
+			Log.Println("response from NewRelic")
+			Log.Println(string(responseJSON))
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+
+		lastErr = fmt.Errorf("error in request to NewRelic, status code %d", resp.StatusCode)
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError {
+			// non-retryable 4xx
+			return lastErr
 		}
-		Log.Println("response from NewRelic")
-		Log.Println(string(responseJSON))
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		Log.Printf("Error in request to NewRelic, status code %d", resp.StatusCode)
+	Log.Printf("giving up sending metrics to NewRelic after %d attempts: %s", policy.MaxAttempts, lastErr)
+	return lastErr
+}
+
+// backoffWithJitter computes the sleep duration before retry attempt,
+// doubling policy.Base each attempt up to policy.Cap and adding up to
+// one more policy.Base of jitter.
+func backoffWithJitter(policy RetryPolicy, attempt int) time.Duration {
+	backoff := policy.Base * time.Duration(uint64(1)<<uint(attempt-1))
+	if backoff <= 0 || backoff > policy.Cap {
+		backoff = policy.Cap
 	}
+
+	jitter := time.Duration(rand.Int63n(int64(policy.Base) + 1))
+
+	return backoff + jitter
 }
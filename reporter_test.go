@@ -0,0 +1,99 @@
+package simplerelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffWithJitterBounds(t *testing.T) {
+
+	policy := RetryPolicy{Base: 100 * time.Millisecond, Cap: time.Second, MaxAttempts: 5}
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		backoff := backoffWithJitter(policy, attempt)
+		min := policy.Base
+		max := policy.Cap + policy.Base
+		if backoff < min || backoff > max {
+			t.Errorf("attempt %d: backoff %s out of bounds [%s, %s]", attempt, backoff, min, max)
+		}
+	}
+}
+
+func TestBackoffWithJitterGrows(t *testing.T) {
+
+	policy := RetryPolicy{Base: 100 * time.Millisecond, Cap: 10 * time.Second, MaxAttempts: 5}
+
+	// strip jitter by comparing the minimum possible value per attempt
+	prevMin := time.Duration(0)
+	for attempt := 1; attempt <= 4; attempt++ {
+		backoff := backoffWithJitter(policy, attempt)
+		minBackoff := policy.Base * time.Duration(uint64(1)<<uint(attempt-1))
+		if backoff < minBackoff || backoff > minBackoff+policy.Base {
+			t.Errorf("attempt %d: backoff %s out of bounds [%s, %s]", attempt, backoff, minBackoff, minBackoff+policy.Base)
+		}
+		if minBackoff <= prevMin {
+			t.Errorf("attempt %d: expected backoff to grow, got %s after %s", attempt, minBackoff, prevMin)
+		}
+		prevMin = minBackoff
+	}
+}
+
+func TestEnqueueBounded(t *testing.T) {
+
+	sink := &NewRelicSink{retryPolicy: DefaultRetryPolicy}
+
+	for i := 0; i < maxQueuedPayloads+5; i++ {
+		sink.enqueue([]byte{byte(i)})
+	}
+
+	if len(sink.queue) != maxQueuedPayloads {
+		t.Fatalf("expected queue capped at %d, got %d", maxQueuedPayloads, len(sink.queue))
+	}
+
+	// the oldest entries should have been dropped, keeping the newest ones
+	if sink.queue[len(sink.queue)-1][0] != byte(maxQueuedPayloads+4) {
+		t.Errorf("expected newest payload to be retained, got %v", sink.queue[len(sink.queue)-1])
+	}
+}
+
+func TestNewRelicSinkPublishDoesNotBlockOnRetries(t *testing.T) {
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink := &NewRelicSink{
+		host:        "host",
+		guid:        defaultGUID,
+		duration:    60,
+		licence:     "licence",
+		version:     "1.0.0",
+		url:         server.URL,
+		retryPolicy: RetryPolicy{Base: 10 * time.Millisecond, Cap: 50 * time.Millisecond, MaxAttempts: 3},
+	}
+
+	start := time.Now()
+	if err := sink.Publish("app", map[string]float32{"requests": 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("expected Publish to return immediately rather than block on retries, took %s", elapsed)
+	}
+
+	// Give the background flushQueue goroutine time to run through all
+	// MaxAttempts retries against the always-503 server.
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&requests) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Errorf("expected 3 retry attempts to reach the server, got %d", got)
+	}
+}
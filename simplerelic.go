@@ -26,12 +26,36 @@ func onReqStartHandler(c *gin.Context) {
 	c.Set("reqStartTime", time.Now())
 }
 
-func onReqEndHandler(c *gin.Context) {
-	for _, v := range SimpleReporter.metrics {
-		v.Update(c)
+// requestInfoFromGin builds the framework-agnostic RequestInfo that
+// AppMetric.Update expects out of a Gin context
+func requestInfoFromGin(c *gin.Context) RequestInfo {
+
+	var duration time.Duration
+	if startTime, exists := c.Get("reqStartTime"); exists {
+		if t, ok := startTime.(time.Time); ok {
+			duration = time.Since(t)
+		}
+	}
+
+	var reqErr error
+	if ginErr := c.Errors.Last(); ginErr != nil {
+		reqErr = ginErr
+	}
+
+	return RequestInfo{
+		Method:        c.Request.Method,
+		Path:          c.Request.URL.Path,
+		RouteTemplate: c.FullPath(),
+		Status:        c.Writer.Status(),
+		Duration:      duration,
+		Err:           reqErr,
 	}
 }
 
+func onReqEndHandler(c *gin.Context) {
+	SimpleReporter.Update(requestInfoFromGin(c))
+}
+
 // Handler is a gin middleware that updates metrics
 func Handler() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -41,8 +65,9 @@ func Handler() gin.HandlerFunc {
 	}
 }
 
-// InitDefaultReporter creates a new reporter and adds standard metrics
-func InitDefaultReporter(appname string, licence string, verbose bool) (*Reporter, error) {
+// InitDefaultReporter creates a new reporter and adds standard metrics.
+// Additional sinks can be passed in alongside the default NewRelic one.
+func InitDefaultReporter(appname string, licence string, verbose bool, sinks ...Sink) (*Reporter, error) {
 
 	var err error
 	SimpleReporter, err = NewReporter(appname, licence, verbose)
@@ -58,6 +83,10 @@ func InitDefaultReporter(appname string, licence string, verbose bool) (*Reporte
 	SimpleReporter.AddMetric(NewErrorRatePerEndpoint(DefaultEndpoints))
 	SimpleReporter.AddMetric(NewResponseTimePerEndpoint(DefaultEndpoints))
 
+	for _, sink := range sinks {
+		SimpleReporter.AddSink(sink)
+	}
+
 	return SimpleReporter, nil
 }
 